@@ -0,0 +1,158 @@
+// Package health implements active backend health checking for go-proxy's
+// load balancing modes.
+package health
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// State describes the liveness of a backend as last observed by a
+// Checker.
+type State int
+
+const (
+	// Unknown backends have not completed a probe yet.
+	Unknown State = iota
+	// Up backends answered their last probe.
+	Up
+	// Down backends failed their last probe.
+	Down
+)
+
+// maxBackoff caps the re-probe interval for a persistently dead backend.
+const maxBackoff = 2 * time.Minute
+
+// Checker periodically TCP/TLS dials a set of backends and tracks
+// whether each one is reachable. A backend that fails is re-probed with
+// exponential backoff instead of on every interval tick, so a
+// persistently dead host does not get hammered with connection attempts.
+type Checker struct {
+	// Network is passed to Dial, e.g. "tcp".
+	Network string
+	// Interval between probes of a healthy backend.
+	Interval time.Duration
+	// Timeout bounds each individual probe dial.
+	Timeout time.Duration
+	// Dial overrides how a backend is probed, e.g. to speak TLS. Defaults
+	// to a plain net.Dialer.
+	Dial func(network, addr string) (net.Conn, error)
+
+	mu      sync.RWMutex
+	state   map[string]State
+	backoff map[string]time.Duration
+	latency map[string]time.Duration
+
+	stop chan struct{}
+}
+
+// NewChecker returns a Checker ready to Watch targets.
+func NewChecker(network string, interval, timeout time.Duration) *Checker {
+	return &Checker{
+		Network:  network,
+		Interval: interval,
+		Timeout:  timeout,
+		state:    make(map[string]State),
+		backoff:  make(map[string]time.Duration),
+		latency:  make(map[string]time.Duration),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Watch starts probing every target in the background until Stop is
+// called.
+func (c *Checker) Watch(targets []string) {
+	for _, target := range targets {
+		go c.probeLoop(target)
+	}
+}
+
+func (c *Checker) probeLoop(target string) {
+	for {
+		wait := c.Interval
+		if !c.probe(target) {
+			wait = c.nextBackoff(target)
+		} else {
+			c.resetBackoff(target)
+		}
+		select {
+		case <-time.After(wait):
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Checker) probe(target string) bool {
+	dial := c.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: c.Timeout}).Dial
+	}
+	start := time.Now()
+	conn, err := dial(c.Network, target)
+	elapsed := time.Since(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency[target] = elapsed
+	if err != nil {
+		c.state[target] = Down
+		return false
+	}
+	conn.Close()
+	c.state[target] = Up
+	return true
+}
+
+// Latency returns the dial latency observed on target's last probe.
+func (c *Checker) Latency(target string) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latency[target]
+}
+
+func (c *Checker) nextBackoff(target string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.backoff[target]
+	if cur == 0 {
+		cur = c.Interval
+	} else {
+		cur *= 2
+		if cur > maxBackoff {
+			cur = maxBackoff
+		}
+	}
+	c.backoff[target] = cur
+	return cur
+}
+
+func (c *Checker) resetBackoff(target string) {
+	c.mu.Lock()
+	c.backoff[target] = 0
+	c.mu.Unlock()
+}
+
+// Stop halts all probing goroutines started by Watch.
+func (c *Checker) Stop() { close(c.stop) }
+
+// IsUp reports whether target's last probe succeeded. A backend that has
+// not been probed yet is treated as up, so it can take traffic before the
+// first health check completes.
+func (c *Checker) IsUp(target string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state[target] != Down
+}
+
+// Alive filters candidates down to the ones currently considered up.
+func (c *Checker) Alive(candidates []string) []string {
+	live := make([]string, 0, len(candidates))
+	for _, host := range candidates {
+		if c.IsUp(host) {
+			live = append(live, host)
+		}
+	}
+	return live
+}
@@ -0,0 +1,80 @@
+// Package metrics exposes Prometheus collectors for go-proxy's connection
+// lifecycle. Collectors are registered with the default registry on
+// import; serve them with promhttp.Handler() alongside proxy.StatusHandler.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// Accepted counts connections accepted on a listening endpoint,
+	// before any routing or auth decision. Incremented from
+	// runTo/balanceTo/runSrv/balacnceSrv.
+	Accepted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_proxy",
+		Name:      "accepted_total",
+		Help:      "Total connections accepted, by listening endpoint.",
+	}, []string{"from"})
+
+	// ActiveConns tracks in-flight proxied connections, by endpoint and
+	// the backend picked for them. The backend label is empty for
+	// endpoints that do not balance (runTo/runSrv), where no single
+	// backend is picked up front.
+	ActiveConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "go_proxy",
+		Name:      "active_conns",
+		Help:      "Currently in-flight proxied connections, by endpoint and backend.",
+	}, []string{"from", "to"})
+
+	// BytesIn counts bytes read from the backend and written back to the
+	// client, incremented from handleConn.
+	BytesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_proxy",
+		Name:      "bytes_in_total",
+		Help:      "Bytes read from backend and written to client.",
+	}, []string{"from", "to"})
+
+	// BytesOut counts bytes read from the client and written to the
+	// backend, incremented from handleConn.
+	BytesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_proxy",
+		Name:      "bytes_out_total",
+		Help:      "Bytes read from client and written to backend.",
+	}, []string{"from", "to"})
+
+	// BackendDialLatency observes the time to dial a backend connection,
+	// incremented from handleConn.
+	BackendDialLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "go_proxy",
+		Name:      "backend_dial_latency_seconds",
+		Help:      "Time to dial a backend connection.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"from", "to"})
+
+	// DiscoveryUpdates counts backend set changes observed from a
+	// Discovery watcher, incremented from runSrv/balacnceSrv.
+	DiscoveryUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_proxy",
+		Name:      "discovery_updates_total",
+		Help:      "Backend set changes observed from a Discovery watcher.",
+	}, []string{"from"})
+
+	// TLSHandshakeErrors counts TLS handshake failures on the ingress
+	// leg, incremented from acceptWorker/handleConn.
+	TLSHandshakeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "go_proxy",
+		Name:      "tls_handshake_errors_total",
+		Help:      "TLS handshake failures, by endpoint.",
+	}, []string{"from"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		Accepted,
+		ActiveConns,
+		BytesIn,
+		BytesOut,
+		BackendDialLatency,
+		DiscoveryUpdates,
+		TLSHandshakeErrors,
+	)
+}
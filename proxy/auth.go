@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrAuthDenied is returned by an Authenticator to reject a connection.
+var ErrAuthDenied = errors.New("proxy: authentication denied")
+
+// Authenticator decides whether an ingress connection may proceed to the
+// backend dial. It is invoked from handleConn with the post-PROXY-protocol
+// net.Conn (the terminated TLS conn, for TLSConfig.Server/Reencrypt
+// endpoints), before any bytes are forwarded to a backend. Implementations
+// that need to peek application bytes (a CONNECT request line and
+// headers, for Basic auth or a bearer token) return a replacement
+// net.Conn with those bytes pushed back, so the rest of handleConn still
+// sees the stream from the beginning.
+type Authenticator interface {
+	Authenticate(conn net.Conn) (net.Conn, error)
+}
+
+// CIDRPolicy authenticates ingress connections by source address. Deny is
+// checked first; when Allow is empty, every address not denied is
+// authenticated.
+type CIDRPolicy struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+func (p *CIDRPolicy) Authenticate(conn net.Conn) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, ErrAuthDenied
+	}
+	for _, n := range p.Deny {
+		if n.Contains(ip) {
+			return nil, ErrAuthDenied
+		}
+	}
+	if len(p.Allow) == 0 {
+		return conn, nil
+	}
+	for _, n := range p.Allow {
+		if n.Contains(ip) {
+			return conn, nil
+		}
+	}
+	return nil, ErrAuthDenied
+}
+
+// peekConnect reads an HTTP CONNECT request line and headers off conn,
+// returning the parsed request and a conn with those bytes pushed back so
+// the request can still be answered (200 or 407) by the caller.
+func peekConnect(conn net.Conn) (*http.Request, net.Conn, error) {
+	var seen bytes.Buffer
+	r := bufio.NewReader(io.TeeReader(conn, &seen))
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// seen holds every byte read off conn so far: the request itself and
+	// anything r buffered past its headers.
+	return req, &prefixConn{Conn: conn, prefix: seen.Bytes()}, nil
+}
+
+func parseBasicAuth(header string) (user, pass string, ok bool) {
+	const prefix = "Basic "
+	if !strings.HasPrefix(header, prefix) {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// HtpasswdAuth authenticates CONNECT-style requests carrying HTTP Basic
+// credentials in a Proxy-Authorization header, verified against an
+// htpasswd-style file of "user:hash" lines (bcrypt or {SHA} entries). The
+// file is hot-reloaded on change.
+type HtpasswdAuth struct {
+	path string
+
+	mu    sync.RWMutex
+	creds map[string]string
+}
+
+// NewHtpasswdAuth loads path and watches it for changes.
+func NewHtpasswdAuth(path string) (*HtpasswdAuth, error) {
+	a := &HtpasswdAuth{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	go a.watch()
+	return a, nil
+}
+
+func (a *HtpasswdAuth) reload() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	creds := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		creds[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.creds = creds
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *HtpasswdAuth) watch() {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "path": a.path}).Warning("htpasswd watch")
+		return
+	}
+	defer w.Close()
+	if err := w.Add(filepath.Dir(a.path)); err != nil {
+		log.WithFields(log.Fields{"err": err, "path": a.path}).Warning("htpasswd watch")
+		return
+	}
+	for event := range w.Events {
+		if filepath.Clean(event.Name) != filepath.Clean(a.path) {
+			continue
+		}
+		if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+			continue
+		}
+		if err := a.reload(); err != nil {
+			log.WithFields(log.Fields{"err": err, "path": a.path}).Warning("htpasswd reload")
+		}
+	}
+}
+
+func (a *HtpasswdAuth) verify(user, pass string) bool {
+	a.mu.RLock()
+	hash, ok := a.creds[user]
+	a.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		return hash[len("{SHA}"):] == base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+}
+
+func (a *HtpasswdAuth) Authenticate(conn net.Conn) (net.Conn, error) {
+	req, rest, err := peekConnect(conn)
+	if err != nil {
+		return nil, err
+	}
+	user, pass, ok := parseBasicAuth(req.Header.Get("Proxy-Authorization"))
+	if !ok || !a.verify(user, pass) {
+		return nil, ErrAuthDenied
+	}
+	return rest, nil
+}
+
+// BearerTokenAuth authenticates CONNECT-style requests carrying a static
+// bearer token in a Proxy-Authorization header.
+type BearerTokenAuth struct {
+	Token string
+}
+
+func (a *BearerTokenAuth) Authenticate(conn net.Conn) (net.Conn, error) {
+	req, rest, err := peekConnect(conn)
+	if err != nil {
+		return nil, err
+	}
+	want := "Bearer " + a.Token
+	got := req.Header.Get("Proxy-Authorization")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return nil, ErrAuthDenied
+	}
+	return rest, nil
+}
+
+// MTLSPolicy authenticates connections whose TLS layer has already been
+// terminated with client certificates requested, matching the client
+// certificate's subject CN or DNS SANs against an allow list. MTLSPolicy
+// does not verify the certificate itself; it is verified only when
+// TLSConfig.Server sets ClientAuth to VerifyClientCertIfGiven or
+// RequireAndVerifyClientCert (with RequireAnyClientCert it is not).
+type MTLSPolicy struct {
+	// AllowedSubjects lists acceptable certificate common names.
+	AllowedSubjects []string
+	// AllowedSANs lists acceptable DNS SAN entries.
+	AllowedSANs []string
+}
+
+func (p *MTLSPolicy) Authenticate(conn net.Conn) (net.Conn, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, ErrAuthDenied
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, ErrAuthDenied
+	}
+	cert := state.PeerCertificates[0]
+	for _, subject := range p.AllowedSubjects {
+		if cert.Subject.CommonName == subject {
+			return conn, nil
+		}
+	}
+	for _, san := range p.AllowedSANs {
+		for _, dns := range cert.DNSNames {
+			if dns == san {
+				return conn, nil
+			}
+		}
+	}
+	return nil, ErrAuthDenied
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+type fakeAddrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *fakeAddrConn) RemoteAddr() net.Addr { return c.remote }
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("ParseCIDR(%q): %v", s, err)
+	}
+	return n
+}
+
+func TestCIDRPolicyDenyWinsOverAllow(t *testing.T) {
+	p := &CIDRPolicy{
+		Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")},
+		Deny:  []*net.IPNet{mustCIDR(t, "10.0.0.5/32")},
+	}
+	conn := &fakeAddrConn{remote: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 1}}
+	if _, err := p.Authenticate(conn); err != ErrAuthDenied {
+		t.Fatalf("Authenticate(denied IP) err = %v, want ErrAuthDenied", err)
+	}
+}
+
+func TestCIDRPolicyAllowList(t *testing.T) {
+	p := &CIDRPolicy{Allow: []*net.IPNet{mustCIDR(t, "10.0.0.0/8")}}
+
+	allowed := &fakeAddrConn{remote: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}}
+	if _, err := p.Authenticate(allowed); err != nil {
+		t.Fatalf("Authenticate(in allow list) err = %v, want nil", err)
+	}
+
+	denied := &fakeAddrConn{remote: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 1}}
+	if _, err := p.Authenticate(denied); err != ErrAuthDenied {
+		t.Fatalf("Authenticate(not in allow list) err = %v, want ErrAuthDenied", err)
+	}
+}
+
+func TestCIDRPolicyEmptyAllowListAllowsAnyNotDenied(t *testing.T) {
+	p := &CIDRPolicy{Deny: []*net.IPNet{mustCIDR(t, "192.168.1.1/32")}}
+
+	conn := &fakeAddrConn{remote: &net.TCPAddr{IP: net.ParseIP("8.8.8.8"), Port: 1}}
+	if _, err := p.Authenticate(conn); err != nil {
+		t.Fatalf("Authenticate(not denied) err = %v, want nil", err)
+	}
+}
+
+func TestParseBasicAuth(t *testing.T) {
+	// "alice:hunter2" base64-encoded.
+	const header = "Basic YWxpY2U6aHVudGVyMg=="
+	user, pass, ok := parseBasicAuth(header)
+	if !ok || user != "alice" || pass != "hunter2" {
+		t.Fatalf("parseBasicAuth(%q) = %q, %q, %v; want alice, hunter2, true", header, user, pass, ok)
+	}
+
+	if _, _, ok := parseBasicAuth("Bearer abc"); ok {
+		t.Fatalf("parseBasicAuth(Bearer header) ok = true, want false")
+	}
+}
+
+func TestHtpasswdAuthVerifySHA(t *testing.T) {
+	a := &HtpasswdAuth{creds: map[string]string{
+		// {SHA} of "hunter2"
+		"alice": "{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=",
+	}}
+	if !a.verify("alice", "hunter2") {
+		t.Fatalf("verify(alice, hunter2) = false, want true")
+	}
+	if a.verify("alice", "wrong") {
+		t.Fatalf("verify(alice, wrong) = true, want false")
+	}
+	if a.verify("nobody", "hunter2") {
+		t.Fatalf("verify(nobody, ...) = true, want false")
+	}
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jeffjen/go-proxy/metrics"
+)
+
+// ErrNoLiveBackend is returned by a Balancer when it is given no
+// candidates to choose from, typically because health checking has
+// marked every backend down.
+var ErrNoLiveBackend = errors.New("proxy: no live backend to balance to")
+
+// Balancer selects one backend host from a set of live candidates for a
+// new connection. Implementations must be safe for concurrent use, since
+// balanceTo/balacnceSrv invoke Pick from the dispatch loop for every
+// incoming connection.
+type Balancer interface {
+	Pick(candidates []string) (string, error)
+}
+
+// ConnCounterAware is implemented by balancers that want in-flight
+// connection counts per backend (e.g. LeastConn). SetConnCounter is
+// called once before the balancer is used.
+type ConnCounterAware interface {
+	SetConnCounter(*ConnCounter)
+}
+
+// LatencyAware is implemented by balancers that want per-backend latency
+// samples (e.g. PeakEWMA). Observe is called with the connect+first-byte
+// latency after each dial.
+type LatencyAware interface {
+	Observe(backend string, latency time.Duration)
+}
+
+// ConnCounter tracks the number of in-flight connections per backend, so
+// LeastConn can pick the least loaded live host.
+type ConnCounter struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+// NewConnCounter returns an empty ConnCounter.
+func NewConnCounter() *ConnCounter {
+	return &ConnCounter{count: make(map[string]int)}
+}
+
+// Inc records a new in-flight connection to backend.
+func (c *ConnCounter) Inc(backend string) {
+	c.mu.Lock()
+	c.count[backend]++
+	c.mu.Unlock()
+}
+
+// Dec records that an in-flight connection to backend has ended.
+func (c *ConnCounter) Dec(backend string) {
+	c.mu.Lock()
+	if c.count[backend] > 0 {
+		c.count[backend]--
+	}
+	c.mu.Unlock()
+}
+
+// Count returns the current in-flight connection count for backend.
+func (c *ConnCounter) Count(backend string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count[backend]
+}
+
+// RoundRobin cycles through candidates in order, matching the behavior
+// balanceTo/balacnceSrv used before Balancer existed.
+type RoundRobin struct {
+	mu  sync.Mutex
+	idx int
+}
+
+func (b *RoundRobin) Pick(candidates []string) (string, error) {
+	if len(candidates) == 0 {
+		return "", ErrNoLiveBackend
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	host := candidates[b.idx%len(candidates)]
+	b.idx++
+	return host, nil
+}
+
+// Random picks a uniformly random candidate on every call.
+type Random struct{}
+
+func (Random) Pick(candidates []string) (string, error) {
+	if len(candidates) == 0 {
+		return "", ErrNoLiveBackend
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+// LeastConn picks the candidate with the fewest in-flight connections, as
+// reported by a ConnCounter.
+type LeastConn struct {
+	counter *ConnCounter
+}
+
+// NewLeastConn returns a LeastConn balancer with its own ConnCounter.
+// Call SetConnCounter to share counting with the dispatch loop.
+func NewLeastConn() *LeastConn {
+	return &LeastConn{counter: NewConnCounter()}
+}
+
+func (b *LeastConn) SetConnCounter(c *ConnCounter) { b.counter = c }
+
+func (b *LeastConn) Pick(candidates []string) (string, error) {
+	if len(candidates) == 0 {
+		return "", ErrNoLiveBackend
+	}
+	best, bestN := candidates[0], b.counter.Count(candidates[0])
+	for _, host := range candidates[1:] {
+		if n := b.counter.Count(host); n < bestN {
+			best, bestN = host, n
+		}
+	}
+	return best, nil
+}
+
+// PeakEWMA picks the candidate with the lowest exponentially weighted
+// moving average of recent connect+first-byte latency, decaying old
+// samples so a backend that recovers from a slow patch is not penalized
+// forever. A candidate with no latency sample yet is never preferred over
+// one with a real sample; instead, unobserved candidates are cycled
+// through round robin until each has a sample to judge it by.
+type PeakEWMA struct {
+	mu      sync.Mutex
+	cost    map[string]float64
+	seen    map[string]bool
+	updated map[string]time.Time
+	decay   time.Duration
+	rr      int
+}
+
+// NewPeakEWMA returns a PeakEWMA balancer with the given decay time
+// constant: an old sample's weight falls by a factor of e for every decay
+// that passes. A zero decay defaults to 10s.
+func NewPeakEWMA(decay time.Duration) *PeakEWMA {
+	if decay <= 0 {
+		decay = 10 * time.Second
+	}
+	return &PeakEWMA{
+		cost:    make(map[string]float64),
+		seen:    make(map[string]bool),
+		updated: make(map[string]time.Time),
+		decay:   decay,
+	}
+}
+
+func (b *PeakEWMA) Observe(backend string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	sample := float64(latency)
+	last, seen := b.updated[backend]
+	if !seen {
+		b.cost[backend] = sample
+	} else {
+		weight := math.Exp(-float64(now.Sub(last)) / float64(b.decay))
+		b.cost[backend] = b.cost[backend]*weight + sample*(1-weight)
+	}
+	b.updated[backend] = now
+	b.seen[backend] = true
+}
+
+func (b *PeakEWMA) Pick(candidates []string) (string, error) {
+	if len(candidates) == 0 {
+		return "", ErrNoLiveBackend
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var unseen []string
+	for _, host := range candidates {
+		if !b.seen[host] {
+			unseen = append(unseen, host)
+		}
+	}
+	if len(unseen) > 0 {
+		host := unseen[b.rr%len(unseen)]
+		b.rr++
+		return host, nil
+	}
+
+	best := candidates[0]
+	bestCost := b.cost[best]
+	for _, host := range candidates[1:] {
+		if cost := b.cost[host]; cost < bestCost {
+			best, bestCost = host, cost
+		}
+	}
+	return best, nil
+}
+
+// balancerFor returns opts.Balancer, lazily defaulting to round robin
+// (and wiring up a shared ConnCounter for LeastConn) so that balanceTo
+// and balacnceSrv always have a usable Balancer.
+func balancerFor(opts *ConnOptions) Balancer {
+	if opts.Balancer == nil {
+		opts.Balancer = &RoundRobin{}
+	}
+	if aware, ok := opts.Balancer.(ConnCounterAware); ok && opts.connCounter() == nil {
+		counter := NewConnCounter()
+		opts.setConnCounter(counter)
+		aware.SetConnCounter(counter)
+	}
+	return opts.Balancer
+}
+
+// liveCandidates returns opts.candidates() filtered through
+// opts.HealthCheck, if one is configured.
+func liveCandidates(opts *ConnOptions) []string {
+	candidates := opts.candidates()
+	if opts.HealthCheck == nil {
+		return candidates
+	}
+	return opts.HealthCheck.Alive(candidates)
+}
+
+// LatencyObserver reports a connect+first-byte latency sample for a
+// proxied connection once handleConn has established it.
+type LatencyObserver func(time.Duration)
+
+// latencyObserverFor returns the callback handleConn should invoke with
+// the measured connect+first-byte latency of the connection it is about
+// to dial to host, feeding the sample to opts.Balancer (when it
+// implements LatencyAware, e.g. PeakEWMA) and to
+// metrics.BackendDialLatency.
+func latencyObserverFor(opts *ConnOptions, host string) LatencyObserver {
+	return func(latency time.Duration) {
+		metrics.BackendDialLatency.WithLabelValues(opts.From, host).Observe(latency.Seconds())
+		if aware, ok := opts.Balancer.(LatencyAware); ok {
+			aware.Observe(host, latency)
+		}
+	}
+}
+
+// ByteObserver reports a byte count for one direction of a proxied
+// connection once handleConn's copy for that direction ends.
+type ByteObserver func(n int64)
+
+// byteObserversFor returns the callbacks handleConn should invoke with the
+// number of bytes read from the backend and written to the client, and
+// read from the client and written to the backend, respectively, feeding
+// metrics.BytesIn and metrics.BytesOut.
+func byteObserversFor(opts *ConnOptions, host string) (bytesIn, bytesOut ByteObserver) {
+	bytesIn = func(n int64) { metrics.BytesIn.WithLabelValues(opts.From, host).Add(float64(n)) }
+	bytesOut = func(n int64) { metrics.BytesOut.WithLabelValues(opts.From, host).Add(float64(n)) }
+	return bytesIn, bytesOut
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnCounterIncDec(t *testing.T) {
+	c := NewConnCounter()
+	c.Inc("a")
+	c.Inc("a")
+	c.Inc("b")
+	if got := c.Count("a"); got != 2 {
+		t.Fatalf("Count(a) = %d, want 2", got)
+	}
+	c.Dec("a")
+	if got := c.Count("a"); got != 1 {
+		t.Fatalf("Count(a) after Dec = %d, want 1", got)
+	}
+	c.Dec("a")
+	c.Dec("a") // Dec below zero must not go negative
+	if got := c.Count("a"); got != 0 {
+		t.Fatalf("Count(a) after extra Dec = %d, want 0", got)
+	}
+}
+
+func TestLeastConnPicksFewestInFlight(t *testing.T) {
+	b := NewLeastConn()
+	b.counter.Inc("a")
+	b.counter.Inc("a")
+	b.counter.Inc("b")
+	host, err := b.Pick([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "b" {
+		t.Fatalf("Pick() = %q, want %q", host, "b")
+	}
+}
+
+// TestPeakEWMAUnobservedNeverBeatsObserved guards against an unobserved
+// (or never-successfully-connected) backend's zero-value cost always
+// looking better than any real, positive latency sample.
+func TestPeakEWMAUnobservedNeverBeatsObserved(t *testing.T) {
+	b := NewPeakEWMA(0)
+	b.Observe("slow", 500*time.Millisecond)
+
+	// "new" has no sample yet: it must be offered a turn (explored), not
+	// silently starved, but it must not be treated as strictly better
+	// than "slow" forever once both have been tried.
+	host, err := b.Pick([]string{"slow", "new"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "new" {
+		t.Fatalf("Pick() with an unobserved candidate = %q, want the unobserved one to be explored first", host)
+	}
+
+	b.Observe("new", 10*time.Millisecond)
+	host, err = b.Pick([]string{"slow", "new"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "new" {
+		t.Fatalf("Pick() after both observed = %q, want the lower-latency host %q", host, "new")
+	}
+}
+
+func TestPeakEWMAPickEmpty(t *testing.T) {
+	b := NewPeakEWMA(0)
+	if _, err := b.Pick(nil); err != ErrNoLiveBackend {
+		t.Fatalf("Pick(nil) err = %v, want ErrNoLiveBackend", err)
+	}
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	ctx "context"
+)
+
+// Discovery resolves a dynamic set of backend addresses and watches that
+// set for changes, so Srv and ClusterSrv are not hard-wired to any one
+// service discovery backend.
+type Discovery interface {
+	// Resolve returns the current set of backend addresses.
+	Resolve(c ctx.Context) ([]string, error)
+
+	// Watch streams backend address sets whenever the resolved set
+	// changes, until c is cancelled.
+	Watch(c ctx.Context) (<-chan []string, error)
+}
+
+// EtcdDiscovery resolves backend addresses from an etcd-backed service
+// registry, preserving go-proxy's original discovery behavior.
+type EtcdDiscovery struct {
+	Opts DiscOptions
+}
+
+func (d *EtcdDiscovery) Resolve(c ctx.Context) ([]string, error) {
+	return obtain(&d.Opts)
+}
+
+func (d *EtcdDiscovery) Watch(c ctx.Context) (<-chan []string, error) {
+	newNodes, _ := watch(c, &d.Opts)
+	return newNodes, nil
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	ctx "context"
+	"net"
+	"strconv"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// ConsulDiscovery resolves healthy backends from a Consul service
+// catalog entry, blocking on the agent's health endpoint to wait for
+// changes instead of polling.
+type ConsulDiscovery struct {
+	// Service is the Consul service name to resolve.
+	Service string
+	// Tag optionally restricts resolution to instances carrying Tag.
+	Tag string
+
+	client *consul.Client
+}
+
+func (d *ConsulDiscovery) conn() (*consul.Client, error) {
+	if d.client != nil {
+		return d.client, nil
+	}
+	client, err := consul.NewClient(consul.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	d.client = client
+	return client, nil
+}
+
+func (d *ConsulDiscovery) Resolve(c ctx.Context) ([]string, error) {
+	client, err := d.conn()
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := client.Health().Service(d.Service, d.Tag, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return consulEntriesToHosts(entries), nil
+}
+
+func (d *ConsulDiscovery) Watch(c ctx.Context) (<-chan []string, error) {
+	client, err := d.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	newNodes := make(chan []string)
+	go func() {
+		defer close(newNodes)
+		var lastIndex uint64
+		for {
+			entries, meta, err := client.Health().Service(d.Service, d.Tag, true, &consul.QueryOptions{
+				WaitIndex: lastIndex,
+				WaitTime:  5 * time.Minute,
+			})
+			if err != nil {
+				select {
+				case <-time.After(5 * time.Second):
+				case <-c.Done():
+					return
+				}
+				continue
+			}
+			if meta.LastIndex == lastIndex {
+				// The wait timed out with no change; block again.
+				select {
+				case <-c.Done():
+					return
+				default:
+				}
+				continue
+			}
+			lastIndex = meta.LastIndex
+			select {
+			case newNodes <- consulEntriesToHosts(entries):
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return newNodes, nil
+}
+
+func consulEntriesToHosts(entries []*consul.ServiceEntry) []string {
+	hosts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		hosts = append(hosts, net.JoinHostPort(addr, strconv.Itoa(e.Service.Port)))
+	}
+	return hosts
+}
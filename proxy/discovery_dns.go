@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	ctx "context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSDiscovery resolves backends from a DNS SRV record, e.g.
+// _http._tcp.backend.example.com, and re-resolves it on a fixed TTL
+// instead of relying on a push notification from the resolver.
+type DNSDiscovery struct {
+	// Service and Proto make up the SRV record's service/proto labels,
+	// e.g. "http"/"tcp".
+	Service string
+	Proto   string
+	// Name is the domain the SRV record is attached to.
+	Name string
+
+	// TTL bounds how often the record is re-resolved. Defaults to 30s.
+	TTL time.Duration
+}
+
+func (d *DNSDiscovery) ttl() time.Duration {
+	if d.TTL <= 0 {
+		return 30 * time.Second
+	}
+	return d.TTL
+}
+
+func (d *DNSDiscovery) Resolve(c ctx.Context) ([]string, error) {
+	_, srvs, err := net.LookupSRV(d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		target := strings.TrimSuffix(srv.Target, ".")
+		hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+	}
+	return hosts, nil
+}
+
+func (d *DNSDiscovery) Watch(c ctx.Context) (<-chan []string, error) {
+	newNodes := make(chan []string)
+	go func() {
+		defer close(newNodes)
+		ticker := time.NewTicker(d.ttl())
+		defer ticker.Stop()
+
+		last, _ := d.Resolve(c)
+		for {
+			select {
+			case <-ticker.C:
+				hosts, err := d.Resolve(c)
+				if err != nil || hostsEqual(hosts, last) {
+					continue
+				}
+				last = hosts
+				select {
+				case newNodes <- hosts:
+				case <-c.Done():
+					return
+				}
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return newNodes, nil
+}
+
+// hostsEqual reports whether a and b contain the same hosts, ignoring
+// order (SRV lookups are not guaranteed to return a stable order between
+// calls even when the backend set hasn't changed).
+func hostsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
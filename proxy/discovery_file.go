@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bufio"
+	ctx "context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileDiscovery resolves backends from a newline-delimited file of
+// host:port entries, re-reading it whenever it changes on disk. Useful
+// in environments without a dedicated discovery system, or for testing.
+type FileDiscovery struct {
+	// Path is the backend list file to read and watch.
+	Path string
+}
+
+func (d *FileDiscovery) Resolve(c ctx.Context) ([]string, error) {
+	f, err := os.Open(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			hosts = append(hosts, line)
+		}
+	}
+	return hosts, scanner.Err()
+}
+
+func (d *FileDiscovery) Watch(c ctx.Context) (<-chan []string, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the parent directory, not Path itself: editors and config
+	// management tools typically replace a file atomically (write a temp
+	// file, then rename it over Path), which swaps the inode at Path and
+	// would silently stop delivering events to a watch held on it.
+	if err := watcher.Add(filepath.Dir(d.Path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	newNodes := make(chan []string)
+	go func() {
+		defer watcher.Close()
+		defer close(newNodes)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(d.Path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				hosts, err := d.Resolve(c)
+				if err != nil {
+					continue
+				}
+				select {
+				case newNodes <- hosts:
+				case <-c.Done():
+					return
+				}
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return newNodes, nil
+}
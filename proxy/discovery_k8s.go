@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	ctx "context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// K8sDiscovery resolves backends from a Kubernetes Endpoints object,
+// using the in-cluster service account to talk to the API server.
+type K8sDiscovery struct {
+	// Namespace and Service identify the Endpoints object to resolve.
+	Namespace string
+	Service   string
+
+	clientset *kubernetes.Clientset
+}
+
+func (d *K8sDiscovery) conn() (*kubernetes.Clientset, error) {
+	if d.clientset != nil {
+		return d.clientset, nil
+	}
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.clientset = clientset
+	return clientset, nil
+}
+
+func (d *K8sDiscovery) Resolve(c ctx.Context) ([]string, error) {
+	clientset, err := d.conn()
+	if err != nil {
+		return nil, err
+	}
+	ep, err := clientset.CoreV1().Endpoints(d.Namespace).Get(d.Service, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return endpointsToHosts(ep), nil
+}
+
+func (d *K8sDiscovery) Watch(c ctx.Context) (<-chan []string, error) {
+	clientset, err := d.conn()
+	if err != nil {
+		return nil, err
+	}
+	w, err := clientset.CoreV1().Endpoints(d.Namespace).Watch(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", d.Service).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newNodes := make(chan []string)
+	go func() {
+		defer w.Stop()
+		defer close(newNodes)
+		for {
+			select {
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				ep, ok := event.Object.(*v1.Endpoints)
+				if !ok {
+					continue
+				}
+				select {
+				case newNodes <- endpointsToHosts(ep):
+				case <-c.Done():
+					return
+				}
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return newNodes, nil
+}
+
+func endpointsToHosts(ep *v1.Endpoints) []string {
+	var hosts []string
+	for _, subset := range ep.Subsets {
+		for _, port := range subset.Ports {
+			for _, addr := range subset.Addresses {
+				hosts = append(hosts, fmt.Sprintf("%s:%d", addr.IP, port.Port))
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostsEqual(t *testing.T) {
+	cases := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, nil, true},
+		{[]string{"a:1", "b:2"}, []string{"b:2", "a:1"}, true},
+		{[]string{"a:1"}, []string{"a:1", "b:2"}, false},
+		{[]string{"a:1", "b:2"}, []string{"a:1", "c:3"}, false},
+	}
+	for _, tt := range cases {
+		if got := hostsEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("hostsEqual(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFileDiscoveryResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backends.txt")
+	if err := os.WriteFile(path, []byte("10.0.0.1:80\n\n10.0.0.2:80\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	d := &FileDiscovery{Path: path}
+	hosts, err := d.Resolve(nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	if !hostsEqual(hosts, want) {
+		t.Fatalf("Resolve() = %v, want %v", hosts, want)
+	}
+}
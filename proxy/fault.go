@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FaultSpec describes network fault injection to apply to a proxied
+// connection, for reproducing partition/latency bugs in distributed
+// system tests. A zero value FaultSpec injects no faults.
+type FaultSpec struct {
+	// LatencyMin/LatencyMax add a random delay, uniformly distributed in
+	// [LatencyMin, LatencyMax], before every Read and Write.
+	LatencyMin time.Duration
+	LatencyMax time.Duration
+
+	// RateLimitBps throttles Read and Write combined to at most this many
+	// bytes per second using a token bucket shared by both directions
+	// (with burst capacity equal to one second's worth of tokens), so a
+	// full-duplex connection cannot exceed RateLimitBps in aggregate.
+	// Zero disables throttling.
+	RateLimitBps int64
+
+	// Blackhole accepts the connection but silently drops every byte
+	// written to it and never returns data from reads.
+	Blackhole bool
+
+	// ResetAfterBytes, if non-zero, closes the connection with an error
+	// once this many bytes have been written through it.
+	ResetAfterBytes int64
+
+	// CorruptRate is the independent probability, in [0, 1], that any
+	// given byte written is flipped before it reaches the peer.
+	CorruptRate float64
+}
+
+func (s FaultSpec) enabled() bool {
+	return s.LatencyMax > 0 || s.RateLimitBps > 0 || s.Blackhole ||
+		s.ResetAfterBytes > 0 || s.CorruptRate > 0
+}
+
+// faultRegistry holds the live FaultSpec for each endpoint, keyed by
+// ConnOptions.From, so SetFault/ClearFault can retarget a running proxy
+// without a restart.
+type faultRegistry struct {
+	mu    sync.RWMutex
+	specs map[string]FaultSpec
+}
+
+var faults = &faultRegistry{specs: make(map[string]FaultSpec)}
+
+// SetFault installs or replaces the fault injection behavior for
+// endpoint, taking effect on the next accepted connection.
+func SetFault(endpoint string, spec FaultSpec) {
+	faults.mu.Lock()
+	faults.specs[endpoint] = spec
+	faults.mu.Unlock()
+}
+
+// ClearFault removes any fault injection behavior for endpoint.
+func ClearFault(endpoint string) {
+	faults.mu.Lock()
+	delete(faults.specs, endpoint)
+	faults.mu.Unlock()
+}
+
+// FaultStatus returns the fault currently configured for endpoint, and
+// whether one is installed at all.
+func FaultStatus(endpoint string) (FaultSpec, bool) {
+	faults.mu.RLock()
+	defer faults.mu.RUnlock()
+	spec, ok := faults.specs[endpoint]
+	return spec, ok
+}
+
+// faultFor looks up the live FaultSpec for endpoint, defaulting to a
+// disabled FaultSpec when none is installed.
+func faultFor(endpoint string) FaultSpec {
+	spec, _ := FaultStatus(endpoint)
+	return spec
+}
+
+// WrapFault wraps conn so its Read/Write calls are subject to spec. A
+// disabled spec returns conn unmodified.
+func WrapFault(conn net.Conn, spec FaultSpec) net.Conn {
+	if !spec.enabled() {
+		return conn
+	}
+	fc := &faultConn{Conn: conn, spec: spec}
+	if spec.RateLimitBps > 0 {
+		fc.bucket = newTokenBucket(spec.RateLimitBps)
+	}
+	return fc
+}
+
+type faultConn struct {
+	net.Conn
+	spec    FaultSpec
+	written int64
+	bucket  *tokenBucket
+}
+
+func (c *faultConn) jitter() {
+	if c.spec.LatencyMax <= 0 {
+		return
+	}
+	lo, hi := c.spec.LatencyMin, c.spec.LatencyMax
+	if hi <= lo {
+		time.Sleep(lo)
+		return
+	}
+	time.Sleep(lo + time.Duration(rand.Int63n(int64(hi-lo))))
+}
+
+func (c *faultConn) Read(b []byte) (int, error) {
+	c.jitter()
+	if c.spec.Blackhole {
+		// Keep draining the real connection so a peer close is still
+		// observed, but never surface any bytes to the caller.
+		discard := make([]byte, len(b))
+		for {
+			if _, err := c.Conn.Read(discard); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := c.Conn.Read(b)
+	c.throttle(n)
+	return n, err
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	c.jitter()
+	if c.spec.Blackhole {
+		return len(b), nil // drop silently, report success to the writer
+	}
+	if c.spec.ResetAfterBytes > 0 && atomic.LoadInt64(&c.written) >= c.spec.ResetAfterBytes {
+		c.Conn.Close()
+		return 0, io.ErrClosedPipe
+	}
+	corrupt(b, c.spec.CorruptRate)
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	c.throttle(n)
+	return n, err
+}
+
+func (c *faultConn) throttle(n int) {
+	if c.bucket == nil || n <= 0 {
+		return
+	}
+	c.bucket.take(n)
+}
+
+// tokenBucket is a byte-denominated token bucket shared by a faultConn's
+// Read and Write directions, so RateLimitBps bounds their combined
+// throughput instead of giving each direction its own independent
+// budget. Burst capacity is one second's worth of tokens.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // tokens (bytes) added per second
+	burst    float64 // maximum tokens held
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(rateBps int64) *tokenBucket {
+	rate := float64(rateBps)
+	return &tokenBucket{rate: rate, burst: rate, tokens: rate, lastFill: time.Now()}
+}
+
+// take blocks until n tokens are available, then consumes them. An n
+// larger than the burst capacity is taken in burst-sized parts, since the
+// bucket never holds more than burst tokens at once.
+func (tb *tokenBucket) take(n int) {
+	for remaining := float64(n); remaining > 0; {
+		want := math.Min(remaining, tb.burst)
+		tb.mu.Lock()
+		now := time.Now()
+		tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.lastFill).Seconds()*tb.rate)
+		tb.lastFill = now
+		if tb.tokens >= want {
+			tb.tokens -= want
+			remaining -= want
+			tb.mu.Unlock()
+			continue
+		}
+		wait := time.Duration((want - tb.tokens) / tb.rate * float64(time.Second))
+		tb.tokens = 0
+		tb.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// corrupt flips a random bit in each byte of b independently with
+// probability rate.
+func corrupt(b []byte, rate float64) {
+	if rate <= 0 {
+		return
+	}
+	for i := range b {
+		if rand.Float64() < rate {
+			b[i] ^= 1 << uint(rand.Intn(8))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFaultLifecycle(t *testing.T) {
+	const endpoint = "fault-lifecycle-test:0"
+
+	if _, ok := FaultStatus(endpoint); ok {
+		t.Fatalf("FaultStatus before SetFault = ok, want not installed")
+	}
+
+	spec := FaultSpec{ResetAfterBytes: 1024}
+	SetFault(endpoint, spec)
+	got, ok := FaultStatus(endpoint)
+	if !ok || got != spec {
+		t.Fatalf("FaultStatus after SetFault = %+v, %v; want %+v, true", got, ok, spec)
+	}
+	if faultFor(endpoint) != spec {
+		t.Fatalf("faultFor after SetFault = %+v, want %+v", faultFor(endpoint), spec)
+	}
+
+	// A stopped listener must clear its fault, so a later listener reusing
+	// the same From address doesn't inherit a stale configuration.
+	ClearFault(endpoint)
+	if _, ok := FaultStatus(endpoint); ok {
+		t.Fatalf("FaultStatus after ClearFault = ok, want not installed")
+	}
+	if faultFor(endpoint).enabled() {
+		t.Fatalf("faultFor after ClearFault = enabled, want disabled")
+	}
+}
+
+// TestTokenBucketSharesBudgetAcrossDirections guards against the
+// full-duplex Read/Write bypass of a naive per-call throttle: both
+// directions must draw from the same budget instead of each getting
+// RateLimitBps to themselves.
+func TestTokenBucketSharesBudgetAcrossDirections(t *testing.T) {
+	tb := newTokenBucket(1000) // burst = 1000 bytes, refill at 1000 B/s
+	tb.take(1000)              // drain the initial burst
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); tb.take(100) }()
+	go func() { defer wg.Done(); tb.take(100) }()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// 200 bytes drawn concurrently from a shared 1000 B/s budget must take
+	// about 200ms combined; if each direction got its own budget, this
+	// would finish in about 100ms instead.
+	if elapsed < 150*time.Millisecond {
+		t.Fatalf("took %v to drain 200 bytes from a shared 1000 B/s bucket, want >= ~200ms", elapsed)
+	}
+}
@@ -3,6 +3,9 @@ package proxy
 import (
 	log "github.com/Sirupsen/logrus"
 
+	"github.com/jeffjen/go-proxy/health"
+	"github.com/jeffjen/go-proxy/metrics"
+
 	ctx "context"
 	"crypto/tls"
 	"errors"
@@ -75,14 +78,73 @@ type ConnOptions struct {
 
 	// Balacnce forwarding host using round robin
 	Balance bool
-	// List of forwarding host
+	// List of forwarding host. Read via candidates() and written via
+	// setCandidates() wherever a Discovery watcher may reassign it
+	// concurrently with a Status() call (see toMu).
 	To []string
 
+	// toMu guards To and counter against the data race between Status()
+	// reading them from an arbitrary goroutine and runSrv/balacnceSrv
+	// reassigning To as Discovery reports backend set changes, or
+	// balancerFor lazily creating counter, from their own goroutine.
+	toMu sync.RWMutex
+
+	// Balancer picks the backend for each new connection when Balance is
+	// set. Defaults to round robin when nil.
+	Balancer Balancer
+
+	// HealthCheck, when non-nil, actively probes the backends in To, as
+	// they stand when To/Srv starts, on an interval and excludes unhealthy
+	// backends from the Balancer's candidate set. Backends that a Discovery
+	// watcher adds later are not probed and count as up.
+	HealthCheck *health.Checker
+
+	// counter tracks in-flight connections per backend for balancers that
+	// implement ConnCounterAware (e.g. LeastConn). Lazily created by
+	// balancerFor. Read via connCounter() and written via
+	// setConnCounter(), both synchronized by toMu.
+	counter *ConnCounter
+
 	// TLS config
 	TLSConfig TLSConfig
 
-	// Discovery backend setting
-	Discovery *DiscOptions
+	// AcceptProxyProto enables PROXY protocol v1/v2 auto-detection on
+	// incoming connections, before TLS termination. The detected source
+	// address replaces RemoteAddr() on the accepted net.Conn.
+	AcceptProxyProto bool
+
+	// SendProxyProto, when not ProxyProtoNone, emits a PROXY protocol
+	// header of the given version on the outbound connection dialed in
+	// handleConn, ahead of any proxied application data.
+	SendProxyProto ProxyProtoVersion
+
+	// Authenticator, when non-nil, is invoked from handleConn before the
+	// backend dial. A rejected connection is closed (or, for a CONNECT
+	// front end, answered with 407) instead of being forwarded. See
+	// CIDRPolicy, HtpasswdAuth, BearerTokenAuth, MTLSPolicy.
+	Authenticator Authenticator
+
+	// Fault, when non-nil, seeds the fault injection behavior for From
+	// (see SetFault/ClearFault) so chaos testing can be configured
+	// up front instead of only through the runtime API.
+	Fault *FaultSpec
+
+	// Reencrypt, when non-nil, puts this endpoint in
+	// TerminateAndReencrypt mode: TLSConfig.Server terminates the
+	// ingress leg, and the egress leg re-originates TLS toward the
+	// chosen backend using Reencrypt's identity instead of TLSConfig.Client.
+	Reencrypt *ReencryptOptions
+
+	// Discovery backend setting. Any Discovery implementation works here,
+	// not just etcd (see EtcdDiscovery, ConsulDiscovery, DNSDiscovery,
+	// FileDiscovery, K8sDiscovery).
+	Discovery Discovery
+
+	// SNI, when non-nil, puts this endpoint in tcp+sni mode: From accepts
+	// a TLS ClientHello without terminating it and routes purely on SNI,
+	// splicing the raw connection through so end-to-end TLS between the
+	// client and the chosen backend is preserved. See the SNI function.
+	SNI *SNIOptions
 
 	// Read timeout
 	ReadTimeout time.Duration
@@ -91,6 +153,34 @@ type ConnOptions struct {
 	WriteTimeout time.Duration
 }
 
+// candidates returns To, synchronized against setCandidates.
+func (opts *ConnOptions) candidates() []string {
+	opts.toMu.RLock()
+	defer opts.toMu.RUnlock()
+	return opts.To
+}
+
+// setCandidates reassigns To, synchronized against candidates.
+func (opts *ConnOptions) setCandidates(hosts []string) {
+	opts.toMu.Lock()
+	opts.To = hosts
+	opts.toMu.Unlock()
+}
+
+// connCounter returns counter, synchronized against setConnCounter.
+func (opts *ConnOptions) connCounter() *ConnCounter {
+	opts.toMu.RLock()
+	defer opts.toMu.RUnlock()
+	return opts.counter
+}
+
+// setConnCounter assigns counter, synchronized against connCounter.
+func (opts *ConnOptions) setConnCounter(counter *ConnCounter) {
+	opts.toMu.Lock()
+	opts.counter = counter
+	opts.toMu.Unlock()
+}
+
 type DiscOptions struct {
 	// Service key to registered host
 	Service string
@@ -103,19 +193,42 @@ type DiscOptions struct {
 	AfterIndex uint64
 }
 
+// TLSHandshakeErrorObserver reports an ingress TLS handshake failure for
+// endpoint opts.From, invoked from acceptWorker.
+type TLSHandshakeErrorObserver func()
+
+// tlsHandshakeErrorObserverFor returns the callback acceptWorker should
+// invoke when an accepted connection fails its ingress TLS handshake,
+// feeding metrics.TLSHandshakeErrors.
+func tlsHandshakeErrorObserverFor(opts *ConnOptions) TLSHandshakeErrorObserver {
+	return func() { metrics.TLSHandshakeErrors.WithLabelValues(opts.From).Inc() }
+}
+
 func runTo(newConn <-chan net.Conn, c ctx.Context, opts *ConnOptions) {
 	for yay := true; yay; {
 		select {
 		case conn := <-newConn:
+			metrics.Accepted.WithLabelValues(opts.From).Inc()
+			metrics.ActiveConns.WithLabelValues(opts.From, "").Inc()
+			bytesIn, bytesOut := byteObserversFor(opts, "")
 			work, _ := ctx.WithCancel(c)
-			go handleConn(work, &connOrder{
-				conn,
-				opts.Net,
-				opts.To,
-				opts.ReadTimeout,
-				opts.WriteTimeout,
-				opts.TLSConfig.Client,
-			})
+			go func() {
+				defer metrics.ActiveConns.WithLabelValues(opts.From, "").Dec()
+				handleConn(work, &connOrder{
+					conn,
+					opts.Net,
+					opts.To,
+					opts.ReadTimeout,
+					opts.WriteTimeout,
+					opts.TLSConfig.Client,
+					opts.SendProxyProto,
+					faultFor(opts.From),
+					opts.Reencrypt,
+					latencyObserverFor(opts, ""),
+					bytesIn,
+					bytesOut,
+				})
+			}()
 		case <-c.Done():
 			yay = false
 		}
@@ -123,18 +236,44 @@ func runTo(newConn <-chan net.Conn, c ctx.Context, opts *ConnOptions) {
 }
 
 func balanceTo(newConn <-chan net.Conn, c ctx.Context, opts *ConnOptions) {
-	for yay, r := true, 0; yay; r = (r + 1) % len(opts.To) {
+	balancer := balancerFor(opts)
+	for yay := true; yay; {
 		select {
 		case conn := <-newConn:
+			metrics.Accepted.WithLabelValues(opts.From).Inc()
+			host, err := balancer.Pick(liveCandidates(opts))
+			if err != nil {
+				log.WithFields(log.Fields{"err": err, "from": opts.From}).Warning("balanceTo")
+				conn.Close()
+				continue
+			}
+			counter := opts.connCounter()
+			if counter != nil {
+				counter.Inc(host)
+			}
+			metrics.ActiveConns.WithLabelValues(opts.From, host).Inc()
+			bytesIn, bytesOut := byteObserversFor(opts, host)
 			work, _ := ctx.WithCancel(c)
-			go handleConn(work, &connOrder{
-				conn,
-				opts.Net,
-				opts.To[r : r+1],
-				opts.ReadTimeout,
-				opts.WriteTimeout,
-				opts.TLSConfig.Client,
-			})
+			go func() {
+				defer metrics.ActiveConns.WithLabelValues(opts.From, host).Dec()
+				if counter != nil {
+					defer counter.Dec(host)
+				}
+				handleConn(work, &connOrder{
+					conn,
+					opts.Net,
+					[]string{host},
+					opts.ReadTimeout,
+					opts.WriteTimeout,
+					opts.TLSConfig.Client,
+					opts.SendProxyProto,
+					faultFor(opts.From),
+					opts.Reencrypt,
+					latencyObserverFor(opts, host),
+					bytesIn,
+					bytesOut,
+				})
+			}()
 		case <-c.Done():
 			yay = false
 		}
@@ -147,16 +286,30 @@ func balanceTo(newConn <-chan net.Conn, c ctx.Context, opts *ConnOptions) {
 // Review https://godoc.org/golang.org/x/net/context for understanding the
 // control flow.
 func To(c ctx.Context, opts *ConnOptions) error {
+	if opts.Fault != nil {
+		SetFault(opts.From, *opts.Fault)
+		defer ClearFault(opts.From)
+	}
 	newConn, astp, err := acceptWorker(c, &config{
 		opts.Net,
 		opts.From,
 		opts.TLSConfig.Server,
+		opts.AcceptProxyProto,
+		tlsHandshakeErrorObserverFor(opts),
 	})
 	if err != nil {
 		return err // something bad happend to Accepter
 	}
 	defer func() { <-astp }()
 
+	registerStatus(opts)
+	defer unregisterStatus(opts)
+
+	if opts.HealthCheck != nil {
+		opts.HealthCheck.Watch(opts.To)
+		defer opts.HealthCheck.Stop()
+	}
+
 	log.WithFields(log.Fields{"from": opts.From}).Debug("TO start")
 	if opts.Balance {
 		balanceTo(newConn, c, opts)
@@ -173,7 +326,8 @@ func runSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Context, op
 		select {
 		case nodes := <-newNodes:
 			if nodes != nil {
-				opts.To = nodes
+				metrics.DiscoveryUpdates.WithLabelValues(opts.From).Inc()
+				opts.setCandidates(nodes)
 				// TODO: memory efficient way of doing this?
 				for _, abort := range connList {
 					abort()
@@ -181,18 +335,31 @@ func runSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Context, op
 				connList = make([]ctx.CancelFunc, 0)
 			}
 		case conn := <-newConn:
-			if len(opts.To) == 0 {
+			metrics.Accepted.WithLabelValues(opts.From).Inc()
+			candidates := opts.candidates()
+			if len(candidates) == 0 {
 				conn.Close() // close connection to avoid confusion
 			} else {
+				metrics.ActiveConns.WithLabelValues(opts.From, "").Inc()
+				bytesIn, bytesOut := byteObserversFor(opts, "")
 				work, abort := ctx.WithCancel(c)
-				go handleConn(work, &connOrder{
-					conn,
-					opts.Net,
-					opts.To,
-					opts.ReadTimeout,
-					opts.WriteTimeout,
-					opts.TLSConfig.Client,
-				})
+				go func() {
+					defer metrics.ActiveConns.WithLabelValues(opts.From, "").Dec()
+					handleConn(work, &connOrder{
+						conn,
+						opts.Net,
+						candidates,
+						opts.ReadTimeout,
+						opts.WriteTimeout,
+						opts.TLSConfig.Client,
+						opts.SendProxyProto,
+						faultFor(opts.From),
+						opts.Reencrypt,
+						latencyObserverFor(opts, ""),
+						bytesIn,
+						bytesOut,
+					})
+				}()
 				connList = append(connList, abort)
 			}
 		case <-c.Done():
@@ -203,11 +370,13 @@ func runSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Context, op
 
 func balacnceSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Context, opts *ConnOptions) {
 	var connList = make([]ctx.CancelFunc, 0)
-	for yay, r := true, 0; yay; r = (r + 1) % len(opts.To) {
+	balancer := balancerFor(opts)
+	for yay := true; yay; {
 		select {
 		case nodes := <-newNodes:
 			if nodes != nil {
-				opts.To = nodes
+				metrics.DiscoveryUpdates.WithLabelValues(opts.From).Inc()
+				opts.setCandidates(nodes)
 				// TODO: memory efficient way of doing this?
 				for _, abort := range connList {
 					abort()
@@ -215,18 +384,44 @@ func balacnceSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Contex
 				connList = make([]ctx.CancelFunc, 0)
 			}
 		case conn := <-newConn:
-			if len(opts.To) == 0 {
+			metrics.Accepted.WithLabelValues(opts.From).Inc()
+			candidates := liveCandidates(opts)
+			if len(candidates) == 0 {
 				conn.Close() // close connection to avoid confusion
 			} else {
+				host, err := balancer.Pick(candidates)
+				if err != nil {
+					log.WithFields(log.Fields{"err": err, "from": opts.From}).Warning("balacnceSrv")
+					conn.Close()
+					continue
+				}
+				counter := opts.connCounter()
+				if counter != nil {
+					counter.Inc(host)
+				}
+				metrics.ActiveConns.WithLabelValues(opts.From, host).Inc()
+				bytesIn, bytesOut := byteObserversFor(opts, host)
 				work, abort := ctx.WithCancel(c)
-				go handleConn(work, &connOrder{
-					conn,
-					opts.Net,
-					opts.To[r : r+1],
-					opts.ReadTimeout,
-					opts.WriteTimeout,
-					opts.TLSConfig.Client,
-				})
+				go func() {
+					defer metrics.ActiveConns.WithLabelValues(opts.From, host).Dec()
+					if counter != nil {
+						defer counter.Dec(host)
+					}
+					handleConn(work, &connOrder{
+						conn,
+						opts.Net,
+						[]string{host},
+						opts.ReadTimeout,
+						opts.WriteTimeout,
+						opts.TLSConfig.Client,
+						opts.SendProxyProto,
+						faultFor(opts.From),
+						opts.Reencrypt,
+						latencyObserverFor(opts, host),
+						bytesIn,
+						bytesOut,
+					})
+				}()
 				connList = append(connList, abort)
 			}
 		case <-c.Done():
@@ -244,24 +439,41 @@ func balacnceSrv(newConn <-chan net.Conn, newNodes <-chan []string, c ctx.Contex
 // control flow.
 func Srv(c ctx.Context, opts *ConnOptions) error {
 	if opts.Discovery == nil {
-		panic("DiscOptions missing")
+		panic("Discovery missing")
+	}
+	if opts.Fault != nil {
+		SetFault(opts.From, *opts.Fault)
+		defer ClearFault(opts.From)
 	}
-	if candidates, err := obtain(opts.Discovery); err != nil {
+	if candidates, err := opts.Discovery.Resolve(c); err != nil {
 		log.WithFields(log.Fields{"err": err}).Warning("Srv")
-		opts.To = make([]string, 0)
+		opts.setCandidates(make([]string, 0))
 	} else {
-		opts.To = candidates
+		opts.setCandidates(candidates)
 	}
 	newConn, astp, err := acceptWorker(c, &config{
 		opts.Net,
 		opts.From,
 		opts.TLSConfig.Server,
+		opts.AcceptProxyProto,
+		tlsHandshakeErrorObserverFor(opts),
 	})
 	if err != nil {
 		return err // something bad happend to Accepter
 	}
-	newNodes, wstp := watch(c, opts.Discovery) // spawn Watcher
-	defer func() { _, _ = <-astp, <-wstp }()
+	newNodes, err := opts.Discovery.Watch(c) // spawn Watcher
+	if err != nil {
+		return err
+	}
+	defer func() { <-astp }()
+
+	registerStatus(opts)
+	defer unregisterStatus(opts)
+
+	if opts.HealthCheck != nil {
+		opts.HealthCheck.Watch(opts.candidates())
+		defer opts.HealthCheck.Stop()
+	}
 
 	log.WithFields(log.Fields{"from": opts.From}).Debug("SRV start")
 	if opts.Balance {
@@ -292,12 +504,17 @@ func ClusterTo(c ctx.Context, opts *ConnOptions) error {
 		go func(from string, to []string) {
 			// FIXME: need to report and err out
 			To(c, &ConnOptions{
-				Net:          opts.Net,
-				From:         from,
-				To:           to,
-				TLSConfig:    opts.TLSConfig,
-				ReadTimeout:  opts.ReadTimeout,
-				WriteTimeout: opts.WriteTimeout,
+				Net:              opts.Net,
+				From:             from,
+				To:               to,
+				TLSConfig:        opts.TLSConfig,
+				ReadTimeout:      opts.ReadTimeout,
+				WriteTimeout:     opts.WriteTimeout,
+				AcceptProxyProto: opts.AcceptProxyProto,
+				SendProxyProto:   opts.SendProxyProto,
+				Authenticator:    opts.Authenticator,
+				Fault:            opts.Fault,
+				Reencrypt:        opts.Reencrypt,
 			})
 			wg.Done()
 		}(from, []string{opts.To[idx]})
@@ -315,9 +532,9 @@ func ClusterTo(c ctx.Context, opts *ConnOptions) error {
 // connection as a group.
 func ClusterSrv(c ctx.Context, opts *ConnOptions) error {
 	if opts.Discovery == nil {
-		panic("DiscOptions missing")
+		panic("Discovery missing")
 	}
-	if candidates, err := obtain(opts.Discovery); err != nil {
+	if candidates, err := opts.Discovery.Resolve(c); err != nil {
 		log.WithFields(log.Fields{"err": err}).Warning("ClusterSrv")
 		opts.To = make([]string, 0)
 	} else {
@@ -327,8 +544,10 @@ func ClusterSrv(c ctx.Context, opts *ConnOptions) error {
 		log.WithFields(log.Fields{"err": ErrClusterNodeMismatch}).Warning("ClusterSrv")
 	}
 
-	newNodes, wstp := watch(c, opts.Discovery) // spawn Watcher
-	defer func() { <-wstp }()
+	newNodes, err := opts.Discovery.Watch(c) // spawn Watcher
+	if err != nil {
+		return err
+	}
 
 	for yay := true; yay; {
 		var wg sync.WaitGroup
@@ -342,12 +561,17 @@ func ClusterSrv(c ctx.Context, opts *ConnOptions) error {
 			go func(from string, to []string) {
 				// FIXME: need to report and err out
 				To(work, &ConnOptions{
-					Net:          opts.Net,
-					From:         from,
-					To:           to,
-					TLSConfig:    opts.TLSConfig,
-					ReadTimeout:  opts.ReadTimeout,
-					WriteTimeout: opts.WriteTimeout,
+					Net:              opts.Net,
+					From:             from,
+					To:               to,
+					TLSConfig:        opts.TLSConfig,
+					ReadTimeout:      opts.ReadTimeout,
+					WriteTimeout:     opts.WriteTimeout,
+					AcceptProxyProto: opts.AcceptProxyProto,
+					SendProxyProto:   opts.SendProxyProto,
+					Authenticator:    opts.Authenticator,
+					Fault:            opts.Fault,
+					Reencrypt:        opts.Reencrypt,
 				})
 				log.WithFields(log.Fields{"from": from, "to": to}).Debug("ClusterSrv")
 				wg.Done()
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ProxyProtoVersion selects which PROXY protocol wire format to speak.
+// See http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+type ProxyProtoVersion int
+
+const (
+	// ProxyProtoNone disables PROXY protocol handling.
+	ProxyProtoNone ProxyProtoVersion = iota
+	// ProxyProtoV1 speaks the human readable text header.
+	ProxyProtoV1
+	// ProxyProtoV2 speaks the binary header.
+	ProxyProtoV2
+)
+
+// ErrProxyProtoMalformed is returned when a PROXY protocol header is
+// present but cannot be parsed.
+var ErrProxyProtoMalformed = errors.New("proxy: malformed PROXY protocol header")
+
+var proxyProtoV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// bufferedConn adapts a net.Conn whose first bytes have already been
+// consumed through a bufio.Reader, so the remainder of the stream still
+// reads correctly after header inspection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// proxyProtoConn overrides RemoteAddr with the client address carried in a
+// PROXY protocol header, so downstream logging and ACL checks see the real
+// client endpoint instead of the upstream load balancer.
+type proxyProtoConn struct {
+	net.Conn
+	src net.Addr
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// acceptProxyProto auto-detects and strips a leading PROXY protocol v1 or
+// v2 header from conn before TLS termination happens. If no PROXY
+// protocol header is present the connection is handed back unmodified,
+// with any peeked bytes pushed back onto the stream.
+func acceptProxyProto(conn net.Conn) (net.Conn, error) {
+	r := bufio.NewReader(conn)
+
+	if peek, err := r.Peek(len(proxyProtoV2Sig)); err == nil && bytes.Equal(peek, proxyProtoV2Sig) {
+		src, err := readProxyProtoV2(r)
+		if err != nil {
+			return nil, err
+		}
+		return &proxyProtoConn{Conn: &bufferedConn{Conn: conn, r: r}, src: src}, nil
+	}
+
+	if peek, err := r.Peek(5); err == nil && bytes.Equal(peek, []byte("PROXY")) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		src, err := parseProxyProtoV1(line)
+		if err != nil {
+			return nil, err
+		}
+		return &proxyProtoConn{Conn: &bufferedConn{Conn: conn, r: r}, src: src}, nil
+	}
+
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+// parseProxyProtoV1 parses a "PROXY TCP4 1.2.3.4 5.6.7.8 1234 5678\r\n"
+// style header and returns the claimed source address.
+func parseProxyProtoV1(line string) (net.Addr, error) {
+	fields := strings.Fields(strings.TrimRight(line, "\r\n"))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrProxyProtoMalformed
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, ErrProxyProtoMalformed
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, ErrProxyProtoMalformed
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, ErrProxyProtoMalformed
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyProtoV2 parses the binary PROXY protocol v2 header, already
+// known to be present from its signature, and returns the claimed source
+// address.
+func readProxyProtoV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := readFull(r, hdr); err != nil {
+		return nil, err
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, ErrProxyProtoMalformed
+	}
+	length := binary.BigEndian.Uint16(hdr[14:16])
+	body := make([]byte, length)
+	if _, err := readFull(r, body); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command: no address carried, caller should use the real conn.
+	if verCmd&0x0F == 0 {
+		return nil, nil
+	}
+
+	switch fam >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, ErrProxyProtoMalformed
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, ErrProxyProtoMalformed
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sendProxyProto writes a PROXY protocol header for src/dst onto conn
+// before any application bytes, so a backend expecting PROXY protocol can
+// recover the original client endpoint.
+func sendProxyProto(conn net.Conn, version ProxyProtoVersion, src, dst net.Addr) error {
+	switch version {
+	case ProxyProtoV1:
+		return sendProxyProtoV1(conn, src, dst)
+	case ProxyProtoV2:
+		return sendProxyProtoV2(conn, src, dst)
+	default:
+		return nil
+	}
+}
+
+func sendProxyProtoV1(conn net.Conn, src, dst net.Addr) error {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		_, err := fmt.Fprint(conn, "PROXY UNKNOWN\r\n")
+		return err
+	}
+	proto := "TCP4"
+	if srcTCP.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	_, err := fmt.Fprintf(conn, "PROXY %s %s %s %d %d\r\n", proto, srcTCP.IP, dstTCP.IP, srcTCP.Port, dstTCP.Port)
+	return err
+}
+
+func sendProxyProtoV2(conn net.Conn, src, dst net.Addr) error {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		hdr := append([]byte{}, proxyProtoV2Sig...)
+		hdr = append(hdr, 0x20, 0x00, 0x00, 0x00) // LOCAL, UNSPEC, length 0
+		_, err := conn.Write(hdr)
+		return err
+	}
+
+	var body []byte
+	fam := byte(0x11) // AF_INET, STREAM
+	if srcTCP.IP.To4() == nil {
+		fam = 0x21 // AF_INET6, STREAM
+		body = append(body, srcTCP.IP.To16()...)
+		body = append(body, dstTCP.IP.To16()...)
+	} else {
+		body = append(body, srcTCP.IP.To4()...)
+		body = append(body, dstTCP.IP.To4()...)
+	}
+	portBuf := make([]byte, 4)
+	binary.BigEndian.PutUint16(portBuf[0:2], uint16(srcTCP.Port))
+	binary.BigEndian.PutUint16(portBuf[2:4], uint16(dstTCP.Port))
+	body = append(body, portBuf...)
+
+	hdr := append([]byte{}, proxyProtoV2Sig...)
+	hdr = append(hdr, 0x21, fam)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(body)))
+	hdr = append(hdr, length...)
+	hdr = append(hdr, body...)
+
+	_, err := conn.Write(hdr)
+	return err
+}
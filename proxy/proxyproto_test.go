@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+func TestParseProxyProtoV1(t *testing.T) {
+	src, err := parseProxyProtoV1("PROXY TCP4 192.168.1.1 192.168.1.2 56324 443\r\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tcp, ok := src.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", src)
+	}
+	if tcp.IP.String() != "192.168.1.1" || tcp.Port != 56324 {
+		t.Fatalf("got %v, want 192.168.1.1:56324", tcp)
+	}
+}
+
+func TestParseProxyProtoV1Unknown(t *testing.T) {
+	src, err := parseProxyProtoV1("PROXY UNKNOWN\r\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if src != nil {
+		t.Fatalf("expected nil src for UNKNOWN, got %v", src)
+	}
+}
+
+// TestReadProxyProtoV2Inet pins down the AF_INET source port offset: the
+// wire layout is srcIP[0:4] dstIP[4:8] srcPort[8:10] dstPort[10:12], so a
+// header with distinct src/dst ports must not parse the destination's.
+func TestReadProxyProtoV2Inet(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1111}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2222}
+
+	pr, pw := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- sendProxyProtoV2(pw, src, dst) }()
+
+	r := bufio.NewReader(pr)
+	peek, err := r.Peek(len(proxyProtoV2Sig))
+	if err != nil {
+		t.Fatalf("peek sig: %v", err)
+	}
+	if string(peek) != string(proxyProtoV2Sig) {
+		t.Fatalf("unexpected signature: %x", peek)
+	}
+	got, err := readProxyProtoV2(r)
+	if err != nil {
+		t.Fatalf("readProxyProtoV2: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("sendProxyProtoV2: %v", err)
+	}
+
+	tcp, ok := got.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", got)
+	}
+	if !tcp.IP.Equal(src.IP) || tcp.Port != src.Port {
+		t.Fatalf("got %v, want %v", tcp, src)
+	}
+}
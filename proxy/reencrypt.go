@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// CertProvider returns the client certificate to present on the egress
+// TLS handshake toward backend, for mTLS between the proxy and its
+// backends.
+type CertProvider func(backend string) (*tls.Certificate, error)
+
+// ReencryptOptions configures TerminateAndReencrypt mode: the ingress
+// leg terminates TLS using TLSConfig.Server, and the egress leg
+// re-originates TLS toward the chosen backend with its own identity
+// instead of simply forwarding the client's handshake.
+type ReencryptOptions struct {
+	// CertProvider, if set, supplies a client certificate for the egress
+	// TLS handshake, keyed by backend host:port.
+	CertProvider CertProvider
+
+	// InsecureSkipVerify disables backend certificate verification on
+	// the egress leg. Only intended for lab/test environments.
+	InsecureSkipVerify bool
+}
+
+// BackendTLSConfig builds the egress *tls.Config for backend, deriving
+// ServerName from its hostname and attaching a client certificate from
+// CertProvider when configured.
+func (r *ReencryptOptions) BackendTLSConfig(backend string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(backend)
+	if err != nil {
+		host = backend
+	}
+	cfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: r.InsecureSkipVerify,
+	}
+	if r.CertProvider != nil {
+		cert, err := r.CertProvider(backend)
+		if err != nil {
+			return nil, err
+		}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+	}
+	return cfg, nil
+}
+
+// ConnectionMap records, for each terminated ingress connection, the
+// remote address of the egress connection re-originated on its behalf,
+// keyed by the ingress connection's own remote address (the client's
+// unique endpoint). This lets operators correlate a terminated ingress
+// conn with its re-originated egress conn for debugging and access
+// control.
+type ConnectionMap struct {
+	mu   sync.RWMutex
+	pair map[string]string
+}
+
+var connMap = &ConnectionMap{pair: make(map[string]string)}
+
+// Connections returns the process-wide ConnectionMap populated by
+// TerminateAndReencrypt mode.
+func Connections() *ConnectionMap { return connMap }
+
+// Lookup returns the egress remote address re-originated for the ingress
+// connection from clientAddr, if any.
+func (m *ConnectionMap) Lookup(clientAddr string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	remote, ok := m.pair[clientAddr]
+	return remote, ok
+}
+
+// Record associates an ingress connection's client (remote) address with
+// the remote address of the egress connection re-originated for it.
+func (m *ConnectionMap) Record(client, backend net.Addr) {
+	m.mu.Lock()
+	m.pair[client.String()] = backend.String()
+	m.mu.Unlock()
+}
+
+// Forget removes any recorded egress mapping for an ingress connection's
+// client (remote) address, once that connection has closed.
+func (m *ConnectionMap) Forget(client net.Addr) {
+	m.mu.Lock()
+	delete(m.pair, client.String())
+	m.mu.Unlock()
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+// TestConnectionMapKeyedByClient guards against regressing to keying by
+// the ingress connection's local (listener) address, which is identical
+// for every concurrent client on the same endpoint and would make one
+// connection's Forget delete another's live mapping.
+func TestConnectionMapKeyedByClient(t *testing.T) {
+	m := &ConnectionMap{pair: make(map[string]string)}
+
+	client1 := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51000}
+	client2 := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 51001}
+	backend1 := &net.TCPAddr{IP: net.ParseIP("10.1.0.1"), Port: 443}
+	backend2 := &net.TCPAddr{IP: net.ParseIP("10.1.0.2"), Port: 443}
+
+	m.Record(client1, backend1)
+	m.Record(client2, backend2)
+
+	if got, ok := m.Lookup(client1.String()); !ok || got != backend1.String() {
+		t.Fatalf("Lookup(client1) = %q, %v; want %q, true", got, ok, backend1.String())
+	}
+	if got, ok := m.Lookup(client2.String()); !ok || got != backend2.String() {
+		t.Fatalf("Lookup(client2) = %q, %v; want %q, true", got, ok, backend2.String())
+	}
+
+	m.Forget(client1)
+	if _, ok := m.Lookup(client1.String()); ok {
+		t.Fatalf("Lookup(client1) after Forget = ok, want not found")
+	}
+	// Forgetting client1 must not disturb client2's still-live mapping.
+	if got, ok := m.Lookup(client2.String()); !ok || got != backend2.String() {
+		t.Fatalf("Lookup(client2) after unrelated Forget = %q, %v; want %q, true", got, ok, backend2.String())
+	}
+}
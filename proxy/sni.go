@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/jeffjen/go-proxy/metrics"
+
+	"bytes"
+	ctx "context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// ErrNoSNIRoute is returned when a ClientHello's SNI does not match any
+// route configured in SNIOptions.
+var ErrNoSNIRoute = errors.New("proxy: no route for SNI")
+
+// errAbortHandshake is returned by a GetConfigForClient hook to stop a
+// ClientHello peek short of a real TLS handshake.
+var errAbortHandshake = errors.New("proxy: aborting handshake after ClientHello peek")
+
+// SNIRoutes maps a ClientHello's server name to its backend candidates.
+// A key may carry a single leading "*." wildcard label, e.g.
+// "*.example.com" matches "a.example.com" and "b.a.example.com" but not
+// "example.com" itself. The most specific matching wildcard key wins.
+type SNIRoutes map[string][]string
+
+// RouteFunc picks backend candidates for a ClientHello. When set on
+// SNIOptions it overrides Routes.
+type RouteFunc func(hello *tls.ClientHelloInfo) []string
+
+// SNIOptions configures tcp+sni listener mode: From accepts a TLS
+// ClientHello without terminating it, peeks the SNI, and routes to a
+// backend chosen from Routes or RouteFunc. The rest of the connection is
+// spliced through untouched, so end-to-end TLS between the client and
+// the chosen backend is preserved.
+type SNIOptions struct {
+	// Routes maps server names to backend candidates.
+	Routes SNIRoutes
+
+	// RouteFunc, if set, overrides Routes.
+	RouteFunc RouteFunc
+}
+
+func (o *SNIOptions) route(hello *tls.ClientHelloInfo) ([]string, error) {
+	if o.RouteFunc != nil {
+		if hosts := o.RouteFunc(hello); len(hosts) > 0 {
+			return hosts, nil
+		}
+		return nil, ErrNoSNIRoute
+	}
+	if hosts, ok := o.Routes[hello.ServerName]; ok {
+		return hosts, nil
+	}
+	for name := hello.ServerName; ; {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		if hosts, ok := o.Routes["*"+name[i:]]; ok {
+			return hosts, nil
+		}
+		name = name[i+1:]
+	}
+	return nil, ErrNoSNIRoute
+}
+
+// SNI takes a Context and ConnOptions and begins listening for tcp+sni
+// mode connections.
+// SNI peeks each accepted connection's TLS ClientHello to learn its SNI,
+// without terminating the handshake, and routes to a backend via
+// opts.SNI. The connection is then spliced through unmodified so
+// end-to-end TLS is preserved between client and backend.
+// Review https://godoc.org/golang.org/x/net/context for understanding the
+// control flow.
+func SNI(c ctx.Context, opts *ConnOptions) error {
+	if opts.SNI == nil {
+		panic("SNIOptions missing")
+	}
+	newConn, astp, err := acceptWorker(c, &config{
+		opts.Net,
+		opts.From,
+		nil, // tcp+sni never terminates TLS
+		opts.AcceptProxyProto,
+		tlsHandshakeErrorObserverFor(opts),
+	})
+	if err != nil {
+		return err // something bad happend to Accepter
+	}
+	defer func() { <-astp }()
+
+	registerStatus(opts)
+	defer unregisterStatus(opts)
+
+	balancer := balancerFor(opts)
+
+	log.WithFields(log.Fields{"from": opts.From}).Debug("SNI start")
+	for yay := true; yay; {
+		select {
+		case conn := <-newConn:
+			metrics.Accepted.WithLabelValues(opts.From).Inc()
+			go spliceSNI(conn, opts, balancer)
+		case <-c.Done():
+			yay = false
+		}
+	}
+	log.WithFields(log.Fields{"from": opts.From}).Debug("SNI stop")
+	return ErrProxyEnd
+}
+
+func spliceSNI(conn net.Conn, opts *ConnOptions, balancer Balancer) {
+	hello, peeked, err := peekClientHello(conn)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "from": opts.From}).Warning("SNI")
+		conn.Close()
+		return
+	}
+
+	candidates, err := opts.SNI.route(hello)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "sni": hello.ServerName, "from": opts.From}).Warning("SNI")
+		conn.Close()
+		return
+	}
+	if opts.HealthCheck != nil {
+		candidates = opts.HealthCheck.Alive(candidates)
+	}
+	host, err := balancer.Pick(candidates)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "sni": hello.ServerName, "from": opts.From}).Warning("SNI")
+		conn.Close()
+		return
+	}
+
+	backend, err := net.Dial(opts.Net, host)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err, "to": host, "from": opts.From}).Warning("SNI")
+		conn.Close()
+		return
+	}
+	defer backend.Close()
+	defer peeked.Close()
+
+	if counter := opts.connCounter(); counter != nil {
+		counter.Inc(host)
+		defer counter.Dec(host)
+	}
+
+	metrics.ActiveConns.WithLabelValues(opts.From, host).Inc()
+	defer metrics.ActiveConns.WithLabelValues(opts.From, host).Dec()
+
+	splice(peeked, backend)
+}
+
+// splice copies bytes in both directions between a and b until both
+// directions have finished, so the caller's deferred Close calls never
+// run while one direction is still mid-copy. Whichever direction
+// finishes first only means that side is done sending; the other
+// direction's data may still be in flight.
+func splice(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	<-done
+	<-done
+}
+
+// helloPeekConn buffers everything read from the underlying conn and
+// rejects every write, so handing it to tls.Server().Handshake() yields
+// the ClientHello without ever completing (or responding to) a real
+// handshake.
+type helloPeekConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *helloPeekConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.buf.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *helloPeekConn) Write(b []byte) (int, error) {
+	return 0, errAbortHandshake
+}
+
+// prefixConn replays a buffered prefix before falling back to the
+// underlying conn's own Read, so bytes already consumed while peeking
+// the ClientHello are not lost.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// peekClientHello reads just enough of conn to learn the TLS
+// ClientHello's SNI, then returns a conn that replays those bytes ahead
+// of the rest of the stream, so the connection can still be spliced
+// through untouched.
+func peekClientHello(conn net.Conn) (*tls.ClientHelloInfo, net.Conn, error) {
+	peeker := &helloPeekConn{Conn: conn}
+	var hello *tls.ClientHelloInfo
+	srv := tls.Server(peeker, &tls.Config{
+		GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = &tls.ClientHelloInfo{ServerName: h.ServerName, SupportedProtos: h.SupportedProtos}
+			return nil, errAbortHandshake
+		},
+	})
+	_ = srv.Handshake()
+	if hello == nil {
+		return nil, nil, ErrNoSNIRoute
+	}
+	prefix := append([]byte(nil), peeker.buf.Bytes()...)
+	return hello, &prefixConn{Conn: conn, prefix: prefix}, nil
+}
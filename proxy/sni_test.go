@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSNIRoutesExactAndWildcard(t *testing.T) {
+	opts := &SNIOptions{Routes: SNIRoutes{
+		"a.example.com":   {"10.0.0.1:443"},
+		"*.example.com":   {"10.0.0.2:443"},
+		"*.other.invalid": {"10.0.0.3:443"},
+	}}
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"a.example.com", "10.0.0.1:443"},
+		{"b.example.com", "10.0.0.2:443"},
+		{"deep.b.example.com", "10.0.0.2:443"},
+	}
+	for _, tt := range cases {
+		hosts, err := opts.route(&tls.ClientHelloInfo{ServerName: tt.name})
+		if err != nil {
+			t.Fatalf("route(%q): unexpected error %v", tt.name, err)
+		}
+		if len(hosts) != 1 || hosts[0] != tt.want {
+			t.Fatalf("route(%q) = %v, want [%q]", tt.name, hosts, tt.want)
+		}
+	}
+
+	if _, err := opts.route(&tls.ClientHelloInfo{ServerName: "nomatch.invalid"}); err != ErrNoSNIRoute {
+		t.Fatalf("route(nomatch) err = %v, want ErrNoSNIRoute", err)
+	}
+}
+
+func TestSNIRouteFuncOverridesRoutes(t *testing.T) {
+	called := false
+	opts := &SNIOptions{
+		Routes: SNIRoutes{"a.example.com": {"should-not-be-used:443"}},
+		RouteFunc: func(hello *tls.ClientHelloInfo) []string {
+			called = true
+			return []string{"from-func:443"}
+		},
+	}
+	hosts, err := opts.route(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Fatalf("RouteFunc was not invoked")
+	}
+	if len(hosts) != 1 || hosts[0] != "from-func:443" {
+		t.Fatalf("route() = %v, want [from-func:443]", hosts)
+	}
+}
+
+func TestPeekClientHello(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+
+	go func() {
+		tls.Client(clientSide, &tls.Config{ServerName: "peek.example.com", InsecureSkipVerify: true}).Handshake()
+	}()
+
+	serverSide.SetReadDeadline(time.Now().Add(5 * time.Second))
+	hello, _, err := peekClientHello(serverSide)
+	if err != nil {
+		t.Fatalf("peekClientHello: %v", err)
+	}
+	if hello.ServerName != "peek.example.com" {
+		t.Fatalf("hello.ServerName = %q, want %q", hello.ServerName, "peek.example.com")
+	}
+}
+
+// halfCloseWriter is implemented by *net.TCPConn; splice's test doubles
+// need it to simulate a client that's done sending but still reading.
+type halfCloseWriter interface {
+	CloseWrite() error
+}
+
+func tcpPipe(t *testing.T) (near, far net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer l.Close()
+
+	acceptC := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		acceptC <- conn
+	}()
+	far, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	near = <-acceptC
+	return near, far
+}
+
+// TestSpliceWaitsForBothDirections guards against returning (and letting
+// the caller close both conns, as spliceSNI's defers do) as soon as only
+// one copy direction finishes, which would truncate data still in flight
+// the other way.
+func TestSpliceWaitsForBothDirections(t *testing.T) {
+	aSide, client := tcpPipe(t)
+	defer client.Close()
+	bSide, backend := tcpPipe(t)
+	defer backend.Close()
+
+	// The client is done sending immediately (half-close), so the
+	// aSide->bSide copy direction finishes right away - but the client
+	// is still reading, and the backend is still slowly streaming a
+	// reply on the other direction.
+	client.(halfCloseWriter).CloseWrite()
+
+	const chunks = 8
+	chunk := bytes.Repeat([]byte("x"), 32*1024)
+	go func() {
+		for i := 0; i < chunks; i++ {
+			backend.Write(chunk)
+			time.Sleep(20 * time.Millisecond)
+		}
+		backend.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		splice(aSide, bSide)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("splice did not return")
+	}
+	// Mimic spliceSNI's deferred Close calls, which only run once splice
+	// has returned.
+	aSide.Close()
+	bSide.Close()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	got, _ := io.ReadAll(client)
+	want := chunks * len(chunk)
+	if len(got) != want {
+		t.Fatalf("client received %d bytes, want %d (splice returned before the backend->client copy drained)", len(got), want)
+	}
+}
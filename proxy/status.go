@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// statusRegistry tracks every endpoint currently running in this process
+// via To/Srv/ClusterTo/ClusterSrv, so Status can report a live snapshot.
+var statusRegistry = struct {
+	mu     sync.RWMutex
+	byFrom map[string]*ConnOptions
+}{byFrom: make(map[string]*ConnOptions)}
+
+func registerStatus(opts *ConnOptions) {
+	statusRegistry.mu.Lock()
+	statusRegistry.byFrom[opts.From] = opts
+	statusRegistry.mu.Unlock()
+}
+
+func unregisterStatus(opts *ConnOptions) {
+	statusRegistry.mu.Lock()
+	delete(statusRegistry.byFrom, opts.From)
+	statusRegistry.mu.Unlock()
+}
+
+// BackendStatus is one backend's entry in an EndpointStatus snapshot.
+type BackendStatus struct {
+	Host     string `json:"host"`
+	Up       bool   `json:"up"`
+	InFlight int    `json:"in_flight"`
+}
+
+// EndpointStatus is one listening endpoint's entry in a Status snapshot.
+type EndpointStatus struct {
+	From     string          `json:"from"`
+	Backends []BackendStatus `json:"backends"`
+}
+
+// Status returns a snapshot of every endpoint started in this process:
+// its current backend candidates, each one's health (when HealthCheck is
+// configured), and in-flight connection counts (when a ConnCounterAware
+// balancer is configured), so operators can build dashboards without
+// scraping logs.
+func Status() []EndpointStatus {
+	statusRegistry.mu.RLock()
+	defer statusRegistry.mu.RUnlock()
+
+	snap := make([]EndpointStatus, 0, len(statusRegistry.byFrom))
+	for from, opts := range statusRegistry.byFrom {
+		ep := EndpointStatus{From: from}
+		for _, host := range opts.candidates() {
+			b := BackendStatus{Host: host, Up: true}
+			if opts.HealthCheck != nil {
+				b.Up = opts.HealthCheck.IsUp(host)
+			}
+			if counter := opts.connCounter(); counter != nil {
+				b.InFlight = counter.Count(host)
+			}
+			ep.Backends = append(ep.Backends, b)
+		}
+		snap = append(snap, ep)
+	}
+
+	sort.Slice(snap, func(i, j int) bool { return snap[i].From < snap[j].From })
+	return snap
+}
+
+// StatusHandler serves Status as JSON, for operators wiring up a status
+// endpoint alongside their Prometheus /metrics handler.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Status())
+}
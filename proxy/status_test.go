@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestConnOptionsCandidatesConcurrentAccess guards against the data race
+// between Status() reading To and a Discovery-driven goroutine
+// reassigning it concurrently (see runSrv/balacnceSrv). Run with -race to
+// catch a regression.
+func TestConnOptionsCandidatesConcurrentAccess(t *testing.T) {
+	opts := &ConnOptions{From: "test", To: []string{"a:1"}}
+	registerStatus(opts)
+	defer unregisterStatus(opts)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			opts.setCandidates([]string{"b:2"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			Status()
+		}
+	}()
+	wg.Wait()
+}
+
+// TestConnOptionsConnCounterConcurrentAccess guards against the data race
+// between Status() reading counter and balancerFor lazily creating it
+// (via balanceTo/balacnceSrv/SNI's dispatch goroutine) concurrently. Run
+// with -race to catch a regression.
+func TestConnOptionsConnCounterConcurrentAccess(t *testing.T) {
+	opts := &ConnOptions{From: "test", To: []string{"a:1"}, Balancer: NewLeastConn()}
+	registerStatus(opts)
+	defer unregisterStatus(opts)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			balancerFor(opts)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			Status()
+		}
+	}()
+	wg.Wait()
+}